@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	input := "name,age\nalice,30\nbob,25\n"
+
+	docs, err := readCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readCSV: %s", err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("expected a single document, got %d", len(docs))
+	}
+	rows, ok := docs[0].([]interface{})
+	if !ok || len(rows) != 2 {
+		t.Fatalf("expected 2 rows in a single array document, got %#v", docs[0])
+	}
+
+	var encoded bytes.Buffer
+	if err := writeCSV(&encoded, docs); err != nil {
+		t.Fatalf("writeCSV: %s", err)
+	}
+
+	roundTripped, err := readCSV(strings.NewReader(encoded.String()))
+	if err != nil {
+		t.Fatalf("readCSV (round trip): %s", err)
+	}
+	if rows, ok := roundTripped[0].([]interface{}); !ok || len(rows) != 2 {
+		t.Fatalf("round trip lost rows, got %#v", roundTripped)
+	}
+}
+
+func TestCSVHeaderOnlyDecodesToEmptyDocument(t *testing.T) {
+	docs, err := readCSV(strings.NewReader("name,age\n"))
+	if err != nil {
+		t.Fatalf("readCSV: %s", err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("expected a single document even with no data rows, got %d", len(docs))
+	}
+	rows, ok := docs[0].([]interface{})
+	if !ok || len(rows) != 0 {
+		t.Fatalf("expected an empty array of rows, got %#v", docs[0])
+	}
+}
+
+func TestJSONArrayEncodesAsCSV(t *testing.T) {
+	docs, err := readJSON(strings.NewReader(`[{"name":"alice","age":"30"},{"name":"bob","age":"25"}]`))
+	if err != nil {
+		t.Fatalf("readJSON: %s", err)
+	}
+
+	var encoded bytes.Buffer
+	if err := writeCSV(&encoded, docs); err != nil {
+		t.Fatalf("writeCSV: %s", err)
+	}
+
+	want := "age,name\n30,alice\n25,bob\n"
+	if encoded.String() != want {
+		t.Fatalf("encoded = %q, want %q", encoded.String(), want)
+	}
+}
@@ -23,16 +23,33 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	cueerrors "cuelang.org/go/cue/errors"
+	"cuelang.org/go/cue/format"
+
 	"github.com/BurntSushi/toml"
 	"github.com/alecthomas/kingpin"
+	"github.com/hashicorp/hcl"
+	"github.com/itchyny/gojq"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/titanous/json5"
 	"gopkg.in/yaml.v2"
 )
 
@@ -44,18 +61,41 @@ Will write to stdout if output is unspecified or "-".
 
 Can be used as a pipe filter if both input and output are unspecified or "-".`
 
+// Coder decodes and encodes a stream of one or more documents. Decode
+// returns every document found (a single-element slice for formats that
+// only ever hold one), and the root of each document need not be an
+// object: it may be any value a format's encoding allows, such as a JSON
+// array or a YAML sequence.
 type Coder struct {
 	Format string
-	Decode func(v interface{}, r io.Reader) error
-	Encode func(w io.Writer, v interface{}) error
+	Decode func(r io.Reader) ([]interface{}, error)
+	Encode func(w io.Writer, docs []interface{}) error
 }
 
 var coders = []*Coder{
 	{"yaml", readYAML, writeYAML},
 	{"json", readJSON, writeJSON},
 	{"toml", readTOML, writeTOML},
+	{"hcl", readHCL, nil},
+	{"cue", readCUE, writeCUE},
+	{"json5", readJSON5, nil},
+	{"env", readEnv, writeEnv},
+	{"xml", readXML, writeXML},
+	{"csv", readCSV, writeCSV},
+	{"tsv", readTSV, writeTSV},
+	{"properties", readProperties, writeProperties},
 }
 
+// Per-format behavior that doesn't fit the fixed Decode/Encode signature is
+// threaded through these package-level settings instead of widening Coder;
+// runConvert sets them from flags before decoding, so they apply for the
+// lifetime of one invocation.
+var (
+	csvDelimiter        = ','
+	xmlRoot             = "root"
+	propertiesSeparator = "."
+)
+
 var formats []string
 
 func init() {
@@ -81,38 +121,628 @@ func main() {
 
 	app := kingpin.New(filepath.Base(os.Args[0]), help)
 
-	inputFormat := app.Flag("decode", "Input format.").Short('d').PlaceHolder("FORMAT").Enum(formats...)
-	outputFormat := app.Flag("encode", "Output format.").Short('e').PlaceHolder("FORMAT").Enum(formats...)
-	inputFile := app.Flag("input", "File to read input from.").Short('i').PlaceHolder("PATH").String()
-	outputFile := app.Flag("output", "File to write output to.").Short('o').PlaceHolder("PATH").String()
+	convertCmd := app.Command("convert", "Convert a document between formats (default).").Default()
+	inputFormat := convertCmd.Flag("decode", "Input format.").Short('d').PlaceHolder("FORMAT").Enum(formats...)
+	outputFormat := convertCmd.Flag("encode", "Output format.").Short('e').PlaceHolder("FORMAT").Enum(formats...)
+	inputFile := convertCmd.Flag("input", "File to read input from.").Short('i').PlaceHolder("PATH").String()
+	outputFile := convertCmd.Flag("output", "File to write output to.").Short('o').PlaceHolder("PATH").String()
+	validateSchema := convertCmd.Flag("validate", "Validate decoded data against a schema file before encoding.").PlaceHolder("SCHEMA").String()
+	schemaFormat := convertCmd.Flag("schema-format", "Format of the schema given to --validate.").Default("jsonschema").Enum("jsonschema", "cue")
+	mergeFiles := convertCmd.Flag("merge", "Deep-merge an additional document on top of the input, last one wins (repeatable). Suffix with :FORMAT to override format detection.").PlaceHolder("FILE[:FORMAT]").Strings()
+	mergeStrategy := convertCmd.Flag("merge-strategy", "How to combine slice values found by --merge.").Default("replace").Enum("replace", "append", "deep")
+	renames := convertCmd.Flag("rename", "Rename a dotted key path OLD=NEW in the decoded document (repeatable, applied in order).").PlaceHolder("OLD=NEW").Strings()
+	filterExpr := convertCmd.Flag("filter", "A jq-style expression to select or reshape the document before encoding.").PlaceHolder("EXPR").String()
+	multi := convertCmd.Flag("multi", "Process every document in a multi-document input (YAML streams, concatenated JSON) instead of only the first.").Bool()
+	wrap := convertCmd.Flag("wrap", "How to emit multiple documents read with --multi.").Default("array").Enum("array", "ndjson", "yaml-stream")
+	csvDelim := convertCmd.Flag("csv-delimiter", "Field delimiter for the csv format (tsv always uses tab).").Default(",").String()
+	xmlRootFlag := convertCmd.Flag("xml-root", "Root element name used when encoding XML.").Default("root").String()
+	propsSep := convertCmd.Flag("properties-separator", "Separator used to expand/flatten dotted keys in the properties format.").Default(".").String()
 
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	frontmatterCmd := app.Command("frontmatter", "Convert the front matter of a content file (Markdown, etc.) between formats, leaving the body untouched.")
+	fmOutputFormat := frontmatterCmd.Flag("encode", "Front matter output format.").Short('e').PlaceHolder("FORMAT").Required().Enum(formats...)
+	fmInputFile := frontmatterCmd.Flag("input", "File to read input from.").Short('i').PlaceHolder("PATH").String()
+	fmOutputFile := frontmatterCmd.Flag("output", "File to write output to (defaults to rewriting --input in place).").Short('o').PlaceHolder("PATH").String()
+	fmRecursive := frontmatterCmd.Flag("recursive", "Walk DIR rewriting every matching file in place instead of converting a single file.").PlaceHolder("DIR").String()
+	fmGlob := frontmatterCmd.Flag("glob", "Glob pattern matched against file names under --recursive.").Default("*.md").String()
+
+	serveCmd := app.Command("serve", "Run an HTTP server exposing the coder registry for on-the-fly conversion.")
+	listen := serveCmd.Flag("listen", "Address to listen on.").Default(":8080").String()
+
+	switch kingpin.MustParse(app.Parse(os.Args[1:])) {
+	case frontmatterCmd.FullCommand():
+		app.FatalIfError(runFrontmatter(*fmOutputFormat, *fmInputFile, *fmOutputFile, *fmRecursive, *fmGlob), "frontmatter")
+	case serveCmd.FullCommand():
+		app.FatalIfError(runServe(*listen), "serve")
+	default:
+		runConvert(app, convertOptions{
+			inputFormat:    *inputFormat,
+			outputFormat:   *outputFormat,
+			inputFile:      *inputFile,
+			outputFile:     *outputFile,
+			validateSchema: *validateSchema,
+			schemaFormat:   *schemaFormat,
+			mergeFiles:     *mergeFiles,
+			mergeStrategy:  *mergeStrategy,
+			renames:        *renames,
+			filterExpr:     *filterExpr,
+			multi:          *multi,
+			wrap:           *wrap,
+			csvDelimiter:   *csvDelim,
+			xmlRoot:        *xmlRootFlag,
+			propsSeparator: *propsSep,
+		})
+	}
+}
+
+// convertOptions holds the parsed flags for the convert command's
+// decode -> transform -> encode pipeline.
+type convertOptions struct {
+	inputFormat, outputFormat    string
+	inputFile, outputFile        string
+	validateSchema, schemaFormat string
+	mergeFiles                   []string
+	mergeStrategy                string
+	renames                      []string
+	filterExpr                   string
+	multi                        bool
+	wrap                         string
+	csvDelimiter                 string
+	xmlRoot                      string
+	propsSeparator               string
+}
+
+func runConvert(app *kingpin.Application, opts convertOptions) {
+	if opts.csvDelimiter == "" || len(opts.csvDelimiter) != 1 {
+		app.Fatalf("--csv-delimiter must be exactly one character")
+	}
+	csvDelimiter = rune(opts.csvDelimiter[0])
+	xmlRoot = opts.xmlRoot
+	propertiesSeparator = opts.propsSeparator
 
-	incoder, err := coder(*inputFile, *inputFormat, "reading from stdin")
+	incoder, err := coder(opts.inputFile, opts.inputFormat, "reading from stdin")
 	app.FatalIfError(err, "input")
 	if incoder.Decode == nil {
 		app.Fatalf("input format %s not supported for decoding", incoder.Format)
 	}
 
-	outcoder, err := coder(*outputFile, *outputFormat, "writing to stdout")
+	outcoder, err := coder(opts.outputFile, opts.outputFormat, "writing to stdout")
 	app.FatalIfError(err, "output")
-	if outcoder.Decode == nil {
+	if outcoder.Encode == nil {
 		app.Fatalf("output format %s not supported for encoding", outcoder.Format)
 	}
 
-	infile, incloser, err := file(*inputFile, *inputFormat, os.Stdin, os.Open)
+	infile, incloser, err := file(opts.inputFile, opts.inputFormat, os.Stdin, os.Open)
 	app.FatalIfError(err, "opening input")
 	defer func() { app.FatalIfError(incloser(), "closing input file") }()
 
-	outfile, outcloser, err := file(*outputFile, *outputFormat, os.Stdout, os.Create)
+	outfile, outcloser, err := file(opts.outputFile, opts.outputFormat, os.Stdout, os.Create)
 	app.FatalIfError(err, "opening output")
 	defer func() { app.FatalIfError(outcloser(), "closing output file") }()
 
-	data := map[string]interface{}{}
+	docs, err := incoder.Decode(infile)
+	app.FatalIfError(err, "decoding")
 
-	app.FatalIfError(incoder.Decode(&data, infile), "decoding")
-	app.FatalIfError(outcoder.Encode(outfile, &data), "encoding")
+	toProcess := docs
+	if !opts.multi {
+		if len(docs) == 0 {
+			app.Fatalf("no document found in input")
+		}
+		toProcess = docs[:1]
+	}
+
+	results := make([]interface{}, 0, len(toProcess))
+	for i, doc := range toProcess {
+		result, err := transformDoc(doc, opts)
+		if err != nil && opts.multi {
+			app.Fatalf("document %d: %s", i, err)
+		}
+		app.FatalIfError(err, "transforming")
+		results = append(results, result)
+	}
 
+	switch {
+	case opts.multi && opts.wrap == "ndjson":
+		if outcoder.Format != "json" {
+			app.Fatalf("--wrap ndjson always writes JSON, it cannot be combined with --encode %s", outcoder.Format)
+		}
+		err = writeJSON(outfile, results)
+	case opts.multi && opts.wrap == "yaml-stream":
+		if outcoder.Format != "yaml" {
+			app.Fatalf("--wrap yaml-stream always writes YAML, it cannot be combined with --encode %s", outcoder.Format)
+		}
+		err = writeYAML(outfile, results)
+	case opts.multi:
+		err = outcoder.Encode(outfile, []interface{}{results})
+	default:
+		err = outcoder.Encode(outfile, results)
+	}
+	app.FatalIfError(err, "encoding")
+}
+
+// transformDoc runs a single decoded document through the merge, rename,
+// filter and validate stages, in that order. --merge and --rename require
+// the document to be a map; documents with a non-map root (a JSON array, a
+// YAML sequence, a CSV file's rows) skip straight to filter/validate unless
+// those flags are set, in which case transformDoc reports an error.
+func transformDoc(doc interface{}, opts convertOptions) (interface{}, error) {
+	if len(opts.mergeFiles) > 0 || len(opts.renames) > 0 {
+		data, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("--merge and --rename require a map document, got %T", doc)
+		}
+		if err := applyMerges(data, opts.mergeFiles, opts.mergeStrategy); err != nil {
+			return nil, fmt.Errorf("merging: %s", err)
+		}
+		if err := applyRenames(data, opts.renames); err != nil {
+			return nil, fmt.Errorf("renaming: %s", err)
+		}
+		doc = data
+	}
+
+	result := doc
+	if opts.filterExpr != "" {
+		filtered, err := applyFilter(doc, opts.filterExpr)
+		if err != nil {
+			return nil, fmt.Errorf("filtering: %s", err)
+		}
+		result = filtered
+	}
+
+	if opts.validateSchema != "" {
+		if err := validate(result, opts.validateSchema, opts.schemaFormat); err != nil {
+			return nil, fmt.Errorf("validation: %s", err)
+		}
+	}
+
+	return result, nil
+}
+
+// applyMerges deep-merges each FILE[:FORMAT] spec in order on top of data,
+// last one wins. Object values are merged key by key; how slice values
+// combine is controlled by strategy ("replace", "append" or "deep").
+func applyMerges(data map[string]interface{}, specs []string, strategy string) error {
+	for _, spec := range specs {
+		path, format := spec, ""
+		if i := strings.LastIndexByte(spec, ':'); i >= 0 {
+			path, format = spec[:i], spec[i+1:]
+		}
+		c, err := coder(path, format, fmt.Sprintf("merging %s", path))
+		if err != nil {
+			return err
+		}
+		if c.Decode == nil {
+			return fmt.Errorf("merge format %s not supported for decoding", c.Format)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("opening merge file %s: %s", path, err)
+		}
+		docs, err := c.Decode(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("decoding merge file %s: %s", path, err)
+		}
+		if len(docs) == 0 {
+			return fmt.Errorf("merge file %s contains no document", path)
+		}
+		overlay, ok := docs[0].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("merge file %s must decode to a map", path)
+		}
+		deepMerge(data, overlay, strategy)
+	}
+	return nil
+}
+
+func deepMerge(dst, src map[string]interface{}, strategy string) {
+	for k, sv := range src {
+		dv, exists := dst[k]
+		if exists {
+			if dm, ok := dv.(map[string]interface{}); ok {
+				if sm, ok := sv.(map[string]interface{}); ok {
+					deepMerge(dm, sm, strategy)
+					continue
+				}
+			}
+			if ds, ok := dv.([]interface{}); ok {
+				if ss, ok := sv.([]interface{}); ok {
+					dst[k] = mergeSlices(ds, ss, strategy)
+					continue
+				}
+			}
+		}
+		dst[k] = sv
+	}
+}
+
+func mergeSlices(dst, src []interface{}, strategy string) []interface{} {
+	switch strategy {
+	case "append":
+		return append(append([]interface{}{}, dst...), src...)
+	case "deep":
+		result := append([]interface{}{}, dst...)
+		for i, sv := range src {
+			if i >= len(result) {
+				result = append(result, sv)
+				continue
+			}
+			if dm, ok := result[i].(map[string]interface{}); ok {
+				if sm, ok := sv.(map[string]interface{}); ok {
+					deepMerge(dm, sm, strategy)
+					continue
+				}
+			}
+			result[i] = sv
+		}
+		return result
+	default: // "replace"
+		return src
+	}
+}
+
+// applyRenames moves each OLD=NEW dotted key path in order, removing OLD
+// and then setting its value at NEW. Missing OLD paths are silently skipped.
+func applyRenames(data map[string]interface{}, specs []string) error {
+	for _, spec := range specs {
+		old, new, found := strings.Cut(spec, "=")
+		if !found {
+			return fmt.Errorf("invalid --rename %q: expected OLD=NEW", spec)
+		}
+		value, ok := popPath(data, strings.Split(old, "."))
+		if !ok {
+			continue
+		}
+		if err := setPath(data, strings.Split(new, "."), value); err != nil {
+			return fmt.Errorf("renaming %s to %s: %s", old, new, err)
+		}
+	}
+	return nil
+}
+
+func popPath(data map[string]interface{}, path []string) (interface{}, bool) {
+	m := data
+	for i, key := range path {
+		if i == len(path)-1 {
+			v, ok := m[key]
+			if ok {
+				delete(m, key)
+			}
+			return v, ok
+		}
+		next, ok := m[key].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	return nil, false
+}
+
+func setPath(data map[string]interface{}, path []string, value interface{}) error {
+	m := data
+	for i, key := range path {
+		if i == len(path)-1 {
+			m[key] = value
+			return nil
+		}
+		next, ok := m[key]
+		if !ok {
+			nm := map[string]interface{}{}
+			m[key] = nm
+			m = nm
+			continue
+		}
+		nm, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("path segment %q is not an object", key)
+		}
+		m = nm
+	}
+	return nil
+}
+
+// applyFilter runs a gojq expression against data and returns its first
+// result value, which need not be an object (e.g. ".foo" or "[.items[]]");
+// any further results the expression produces are ignored.
+func applyFilter(data interface{}, expr string) (interface{}, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("parsing filter: %s", err)
+	}
+	iter := query.Run(data)
+	v, ok := iter.Next()
+	if !ok {
+		return nil, fmt.Errorf("filter produced no output")
+	}
+	if err, ok := v.(error); ok {
+		return nil, fmt.Errorf("running filter: %s", err)
+	}
+	return v, nil
+}
+
+// frontMatterFences maps a front matter format to its opening/closing fence
+// line, following Hugo's convention. JSON front matter has no entry: it is
+// delimited by its own matching braces instead of a fence line.
+var frontMatterFences = map[string]string{
+	"yaml": "---",
+	"toml": "+++",
+}
+
+func runFrontmatter(outFormat, inputFile, outputFile, recursiveDir, glob string) error {
+	if recursiveDir != "" {
+		var failed []string
+		err := filepath.Walk(recursiveDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			matched, err := filepath.Match(glob, filepath.Base(path))
+			if err != nil {
+				return err
+			}
+			if !matched {
+				return nil
+			}
+			if err := convertFrontMatterFile(path, path, outFormat); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = append(failed, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to convert %d file(s): %s", len(failed), strings.Join(failed, ", "))
+		}
+		return nil
+	}
+	if inputFile == "" || inputFile == "-" {
+		return fmt.Errorf("--input is required unless --recursive is given")
+	}
+	outputPath := outputFile
+	if outputPath == "" {
+		outputPath = inputFile
+	}
+	return convertFrontMatterFile(inputFile, outputPath, outFormat)
+}
+
+func convertFrontMatterFile(inputPath, outputPath, outFormat string) error {
+	content, err := ioutil.ReadFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("reading %s: %s", inputPath, err)
+	}
+
+	inFormat, front, body, err := splitFrontMatter(content)
+	if err != nil {
+		return fmt.Errorf("%s: %s", inputPath, err)
+	}
+
+	incoder := coderFor(inFormat)
+	outcoder := coderFor(outFormat)
+	if outcoder == nil || outcoder.Encode == nil {
+		return fmt.Errorf("front matter output format %s not supported for encoding", outFormat)
+	}
+
+	docs, err := incoder.Decode(strings.NewReader(front))
+	if err != nil {
+		return fmt.Errorf("%s: decoding front matter: %s", inputPath, err)
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("%s: front matter contains no document", inputPath)
+	}
+	data, ok := docs[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: front matter must decode to a map", inputPath)
+	}
+
+	var encoded bytes.Buffer
+	if err := outcoder.Encode(&encoded, []interface{}{data}); err != nil {
+		return fmt.Errorf("%s: encoding front matter: %s", inputPath, err)
+	}
+
+	var rendered bytes.Buffer
+	if fence, ok := frontMatterFences[outFormat]; ok {
+		rendered.WriteString(fence + "\n")
+		rendered.Write(encoded.Bytes())
+		rendered.WriteString(fence + "\n")
+	} else {
+		rendered.Write(encoded.Bytes())
+		rendered.WriteString("\n")
+	}
+	rendered.WriteString(body)
+
+	return ioutil.WriteFile(outputPath, rendered.Bytes(), 0644)
+}
+
+// splitFrontMatter detects the front matter fence at the start of content
+// (YAML "---", TOML "+++", or an unfenced leading JSON object, per Hugo's
+// convention) and splits it from the remaining body.
+func splitFrontMatter(content []byte) (format, front, body string, err error) {
+	text := string(content)
+	switch {
+	case strings.HasPrefix(text, "---"):
+		front, body, err = splitFenced(text, "---")
+		return "yaml", front, body, err
+	case strings.HasPrefix(text, "+++"):
+		front, body, err = splitFenced(text, "+++")
+		return "toml", front, body, err
+	case strings.HasPrefix(text, "{"):
+		front, body, err = splitJSONFrontMatter(content)
+		return "json", front, body, err
+	default:
+		return "", "", "", fmt.Errorf("no recognized front matter fence (---, +++ or {) at start of file")
+	}
+}
+
+func splitFenced(content, fence string) (front, body string, err error) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	if !scanner.Scan() || strings.TrimRight(scanner.Text(), "\r") != fence {
+		return "", "", fmt.Errorf("missing opening %s fence", fence)
+	}
+	var frontLines []string
+	closed := false
+	for scanner.Scan() {
+		if strings.TrimRight(scanner.Text(), "\r") == fence {
+			closed = true
+			break
+		}
+		frontLines = append(frontLines, scanner.Text())
+	}
+	if !closed {
+		return "", "", fmt.Errorf("missing closing %s fence", fence)
+	}
+	var rest strings.Builder
+	for scanner.Scan() {
+		rest.WriteString(scanner.Text())
+		rest.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+	return strings.Join(frontLines, "\n"), rest.String(), nil
+}
+
+func splitJSONFrontMatter(content []byte) (front, body string, err error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return "", "", fmt.Errorf("decoding JSON front matter: %s", err)
+	}
+	// dec.Buffered() only holds whatever the decoder's internal reader
+	// happened to read ahead, not the rest of the file, so slice the
+	// remainder from the original content using the real offset instead.
+	rest := content[dec.InputOffset():]
+	return string(raw), strings.TrimPrefix(string(rest), "\n"), nil
+}
+
+// formatMIMETypes maps each coder's Format to the media type it's exposed as
+// over HTTP, used both to set Content-Type on responses and to resolve a
+// request's Content-Type/Accept headers back to a format.
+var formatMIMETypes = map[string]string{
+	"yaml":       "application/yaml",
+	"json":       "application/json",
+	"toml":       "application/toml",
+	"hcl":        "application/hcl",
+	"cue":        "application/cue",
+	"json5":      "application/json5",
+	"env":        "text/plain",
+	"xml":        "application/xml",
+	"csv":        "text/csv",
+	"tsv":        "text/tab-separated-values",
+	"properties": "text/x-java-properties",
+}
+
+func mimeForFormat(format string) string {
+	if m, ok := formatMIMETypes[format]; ok {
+		return m
+	}
+	return "application/octet-stream"
+}
+
+func formatForMIME(mimeType string) string {
+	for format, m := range formatMIMETypes {
+		if m == mimeType {
+			return format
+		}
+	}
+	return ""
+}
+
+// runServe starts an HTTP server exposing the coder registry: POST
+// /convert?from=FORMAT&to=FORMAT converts a request body between formats,
+// falling back to the Content-Type and Accept headers when from/to are
+// omitted, and GET /formats reports each format's decode/encode support.
+func runServe(listen string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/convert", handleConvert)
+	mux.HandleFunc("/formats", handleFormats)
+	return http.ListenAndServe(listen, mux)
+}
+
+func handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			if mt, _, err := mime.ParseMediaType(ct); err == nil {
+				from = formatForMIME(mt)
+			}
+		}
+	}
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		to = negotiateFormat(r.Header.Get("Accept"))
+	}
+	if from == "" {
+		http.Error(w, "could not determine source format: pass ?from=FORMAT or set Content-Type", http.StatusBadRequest)
+		return
+	}
+	if to == "" {
+		http.Error(w, "could not determine target format: pass ?to=FORMAT or set Accept", http.StatusBadRequest)
+		return
+	}
+
+	incoder := coderFor(from)
+	if incoder == nil || incoder.Decode == nil {
+		http.Error(w, fmt.Sprintf("source format %s not supported for decoding", from), http.StatusBadRequest)
+		return
+	}
+	outcoder := coderFor(to)
+	if outcoder == nil || outcoder.Encode == nil {
+		http.Error(w, fmt.Sprintf("target format %s not supported for encoding", to), http.StatusBadRequest)
+		return
+	}
+
+	docs, err := incoder.Decode(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("decoding: %s", err), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	if err := outcoder.Encode(&buf, docs); err != nil {
+		http.Error(w, fmt.Sprintf("encoding: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", mimeForFormat(to))
+	w.Write(buf.Bytes())
+}
+
+// negotiateFormat picks the first format in an Accept header's preference
+// order (ignoring q-values) that formatMIMETypes recognizes.
+func negotiateFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mt, _, _ := mime.ParseMediaType(strings.TrimSpace(part))
+		if format := formatForMIME(mt); format != "" {
+			return format
+		}
+	}
+	return ""
+}
+
+type formatCapability struct {
+	Decode bool   `json:"decode"`
+	Encode bool   `json:"encode"`
+	MIME   string `json:"mime"`
+}
+
+func handleFormats(w http.ResponseWriter, r *http.Request) {
+	capabilities := map[string]formatCapability{}
+	for _, c := range coders {
+		capabilities[c.Format] = formatCapability{
+			Decode: c.Decode != nil,
+			Encode: c.Encode != nil,
+			MIME:   mimeForFormat(c.Format),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(capabilities)
 }
 
 func file(file, format string, defaultfile *os.File, opener func(string) (*os.File, error)) (*os.File, func() error, error) {
@@ -156,6 +786,10 @@ func guessformat(file string) (string, error) {
 			e = "yaml"
 		case "tml":
 			e = "toml"
+		case "tf":
+			e = "hcl"
+		case "props":
+			e = "properties"
 		}
 	}
 	if coderFor(e) != nil {
@@ -173,27 +807,612 @@ func coderFor(format string) *Coder {
 	return nil
 }
 
-func readTOML(v interface{}, r io.Reader) error {
-	_, err := toml.DecodeReader(r, &v)
+// validate checks data against the schema found in schemaFile, using
+// schemaFormat ("jsonschema" or "cue") to interpret it. Returns a single
+// error describing every violation, each annotated with its pointer path.
+func validate(data interface{}, schemaFile, schemaFormat string) error {
+	switch schemaFormat {
+	case "cue":
+		return validateCUE(data, schemaFile)
+	default:
+		return validateJSONSchema(data, schemaFile)
+	}
+}
+
+func validateJSONSchema(data interface{}, schemaFile string) error {
+	schema, err := jsonschema.Compile(schemaFile)
+	if err != nil {
+		return fmt.Errorf("compiling schema %s: %s", schemaFile, err)
+	}
+	normalized, err := normalizeForValidation(data)
+	if err != nil {
+		return fmt.Errorf("normalizing data: %s", err)
+	}
+	if err := schema.Validate(normalized); err != nil {
+		// ValidationError's Error() only reports the first leaf cause; its
+		// GoString() lists every cause with its instance pointer.
+		if ve, ok := err.(*jsonschema.ValidationError); ok {
+			return fmt.Errorf("validation failed:\n%#v", ve)
+		}
+		return fmt.Errorf("validation failed:\n%s", err)
+	}
+	return nil
+}
+
+func validateCUE(data interface{}, schemaFile string) error {
+	schemaBytes, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		return fmt.Errorf("reading schema %s: %s", schemaFile, err)
+	}
+	normalized, err := normalizeForValidation(data)
+	if err != nil {
+		return fmt.Errorf("normalizing data: %s", err)
+	}
+	dataBytes, err := json.Marshal(normalized)
+	if err != nil {
+		return fmt.Errorf("marshaling data: %s", err)
+	}
+	ctx := cuecontext.New()
+	schema := ctx.CompileBytes(schemaBytes)
+	if err := schema.Err(); err != nil {
+		return fmt.Errorf("compiling schema %s: %s", schemaFile, err)
+	}
+	value := ctx.CompileBytes(dataBytes)
+	if err := value.Err(); err != nil {
+		return err
+	}
+	if err := schema.Unify(value).Validate(cue.Concrete(true)); err != nil {
+		return fmt.Errorf("validation failed:\n%s", cueerrors.Details(err, nil))
+	}
+	return nil
+}
+
+// normalizeForValidation round-trips data through encoding/json so coders
+// that produce non-JSON-native types (e.g. integer numbers, time.Time values,
+// or the []map[string]interface{} that TOML and HCL decode blocks into)
+// validate the same way a plain JSON document would.
+func normalizeForValidation(data interface{}) (interface{}, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// readTOML decodes a single TOML document. TOML is always table-rooted, so
+// unlike readJSON/readYAML there is no array-at-root or multi-document case
+// to support.
+func readTOML(r io.Reader) ([]interface{}, error) {
+	var v map[string]interface{}
+	if _, err := toml.DecodeReader(r, &v); err != nil {
+		return nil, err
+	}
+	return []interface{}{v}, nil
+}
+
+func writeTOML(w io.Writer, docs []interface{}) error {
+	if len(docs) != 1 {
+		return fmt.Errorf("toml encoding supports exactly one document, got %d", len(docs))
+	}
+	return toml.NewEncoder(w).Encode(docs[0])
+}
+
+// readYAML decodes every document in a "---"-separated YAML stream.
+func readYAML(r io.Reader) ([]interface{}, error) {
+	dec := yaml.NewDecoder(r)
+	var docs []interface{}
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		docs = append(docs, normalizeYAML(v))
+	}
+	if len(docs) == 0 {
+		return nil, io.EOF
+	}
+	return docs, nil
+}
+
+// normalizeYAML recursively rewrites the map[interface{}]interface{} values
+// that yaml.v2 produces for mappings into map[string]interface{}, which is
+// what every other coder and the transform/validation code in this file
+// expects a decoded document to look like.
+func normalizeYAML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalizeYAML(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, val := range v {
+			s[i] = normalizeYAML(val)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// writeYAML encodes each document in turn; the YAML encoder separates
+// successive documents with "---", so multiple docs naturally come out as a
+// YAML stream.
+func writeYAML(w io.Writer, docs []interface{}) error {
+	enc := yaml.NewEncoder(w)
+	for _, d := range docs {
+		if err := enc.Encode(d); err != nil {
+			enc.Close()
+			return err
+		}
+	}
+	return enc.Close()
+}
+
+// readJSON decodes every JSON value found in the input in sequence, which
+// covers a lone value, an array at the root, and concatenated/NDJSON input
+// alike.
+func readJSON(r io.Reader) ([]interface{}, error) {
+	dec := json.NewDecoder(r)
+	var docs []interface{}
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		docs = append(docs, v)
+	}
+	if len(docs) == 0 {
+		return nil, io.EOF
+	}
+	return docs, nil
+}
+
+// writeJSON encodes each document on its own line; for a single document
+// that is plain JSON, for several it is NDJSON.
+func writeJSON(w io.Writer, docs []interface{}) error {
+	enc := json.NewEncoder(w)
+	for _, d := range docs {
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readHCL(r io.Reader) ([]interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var v map[string]interface{}
+	if err := hcl.Decode(&v, string(b)); err != nil {
+		return nil, err
+	}
+	return []interface{}{v}, nil
+}
+
+// readJSON5 decodes a single JSON5 value, which may be an object or an
+// array at the root.
+func readJSON5(r io.Reader) ([]interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := json5.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return []interface{}{v}, nil
+}
+
+func readCUE(r io.Reader) ([]interface{}, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	ctx := cuecontext.New()
+	val := ctx.CompileBytes(b)
+	if err := val.Err(); err != nil {
+		return nil, err
+	}
+	var v interface{}
+	if err := val.Decode(&v); err != nil {
+		return nil, err
+	}
+	return []interface{}{v}, nil
+}
+
+func writeCUE(w io.Writer, docs []interface{}) error {
+	if len(docs) != 1 {
+		return fmt.Errorf("cue encoding supports exactly one document, got %d", len(docs))
+	}
+	ctx := cuecontext.New()
+	val := ctx.Encode(docs[0])
+	if err := val.Err(); err != nil {
+		return err
+	}
+	b, err := format.Node(val.Syntax())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
 	return err
 }
 
-func writeTOML(w io.Writer, v interface{}) error {
-	return toml.NewEncoder(w).Encode(v)
+// readEnv parses a flat KEY=VALUE dotenv file, honoring "export " prefixes,
+// "#" comments and single/double quoted values with backslash escapes.
+func readEnv(r io.Reader) ([]interface{}, error) {
+	result := map[string]interface{}{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid env line %q: missing '='", line)
+		}
+		unquoted, err := unquoteEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid env line %q: %s", line, err)
+		}
+		result[strings.TrimSpace(key)] = unquoted
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return []interface{}{result}, nil
+}
+
+func unquoteEnvValue(value string) (string, error) {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			return strconv.Unquote(value)
+		}
+		return value[1 : len(value)-1], nil
+	}
+	return value, nil
+}
+
+func writeEnv(w io.Writer, docs []interface{}) error {
+	if len(docs) != 1 {
+		return fmt.Errorf("env encoding supports exactly one document, got %d", len(docs))
+	}
+	m, ok := docs[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("env encoding requires a map[string]interface{} document")
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value := fmt.Sprintf("%v", m[k])
+		if needsEnvQuoting(value) {
+			value = strconv.Quote(value)
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func needsEnvQuoting(value string) bool {
+	return strings.ContainsAny(value, " \t\"'\\\n#=")
+}
+
+// readXML decodes a single XML document into nested maps: attributes become
+// "@name" keys, element text becomes a bare string (or a "#text" key when an
+// element also has attributes or children), and repeated sibling tags
+// collapse into a slice.
+func readXML(r io.Reader) ([]interface{}, error) {
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("no root element found")
+			}
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			v, err := decodeXMLElement(dec, start)
+			if err != nil {
+				return nil, err
+			}
+			return []interface{}{v}, nil
+		}
+	}
+}
+
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	result := map[string]interface{}{}
+	for _, a := range start.Attr {
+		result["@"+a.Name.Local] = a.Value
+	}
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			addXMLChild(result, t.Name.Local, child)
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			trimmed := strings.TrimSpace(text.String())
+			if len(result) == 0 {
+				return trimmed, nil
+			}
+			if trimmed != "" {
+				result["#text"] = trimmed
+			}
+			return result, nil
+		}
+	}
+}
+
+func addXMLChild(m map[string]interface{}, name string, value interface{}) {
+	existing, ok := m[name]
+	if !ok {
+		m[name] = value
+		return
+	}
+	if list, ok := existing.([]interface{}); ok {
+		m[name] = append(list, value)
+		return
+	}
+	m[name] = []interface{}{existing, value}
+}
+
+// writeXML encodes a single document as XML under the xmlRoot element name.
+// A map becomes an element with its "@"-prefixed keys as attributes, its
+// "#text" key (if any) as character data, and its remaining keys as child
+// elements; a slice-valued key is repeated as sibling elements.
+func writeXML(w io.Writer, docs []interface{}) error {
+	if len(docs) != 1 {
+		return fmt.Errorf("xml encoding supports exactly one document, got %d", len(docs))
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := encodeXMLElement(enc, xmlRoot, docs[0]); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+func encodeXMLElement(enc *xml.Encoder, name string, value interface{}) error {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		start := xml.StartElement{Name: xml.Name{Local: name}}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if value != nil {
+			if err := enc.EncodeToken(xml.CharData(fmt.Sprintf("%v", value))); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(xml.EndElement{Name: start.Name})
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	var childNames []string
+	for k := range m {
+		switch {
+		case strings.HasPrefix(k, "@"):
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: strings.TrimPrefix(k, "@")}, Value: fmt.Sprintf("%v", m[k])})
+		case k == "#text":
+		default:
+			childNames = append(childNames, k)
+		}
+	}
+	sort.Slice(start.Attr, func(i, j int) bool { return start.Attr[i].Name.Local < start.Attr[j].Name.Local })
+	sort.Strings(childNames)
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if text, ok := m["#text"]; ok {
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprintf("%v", text))); err != nil {
+			return err
+		}
+	}
+	for _, k := range childNames {
+		if list, ok := m[k].([]interface{}); ok {
+			for _, item := range list {
+				if err := encodeXMLElement(enc, k, item); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := encodeXMLElement(enc, k, m[k]); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(xml.EndElement{Name: start.Name})
+}
+
+// readCSV decodes a CSV/TSV file as a single document whose value is the
+// array of data rows, each row a map keyed by the header row; all values
+// come out as strings. Keeping the whole file as one document (rather than
+// one document per row) matches how every other coder's root may be "any
+// value a format's encoding allows", and lets the default (non-multi)
+// convert pipeline, which only processes the first document, see every row.
+func readCSV(r io.Reader) ([]interface{}, error) {
+	return readDelimited(r, csvDelimiter)
 }
 
-func readYAML(v interface{}, r io.Reader) error {
-	return yaml.NewDecoder(r).Decode(&v)
+func writeCSV(w io.Writer, docs []interface{}) error {
+	return writeDelimited(w, docs, csvDelimiter)
+}
+
+func readTSV(r io.Reader) ([]interface{}, error) {
+	return readDelimited(r, '\t')
+}
+
+func writeTSV(w io.Writer, docs []interface{}) error {
+	return writeDelimited(w, docs, '\t')
+}
+
+func readDelimited(r io.Reader, delimiter rune) ([]interface{}, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = delimiter
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, io.EOF
+	}
+	header := records[0]
+	rows := make([]interface{}, 0, len(records)-1)
+	for _, row := range records[1:] {
+		m := map[string]interface{}{}
+		for i, h := range header {
+			if i < len(row) {
+				m[h] = row[i]
+			}
+		}
+		rows = append(rows, m)
+	}
+	return []interface{}{rows}, nil
+}
+
+// writeDelimited encodes the single document in docs, which must be an
+// array of row-maps (what readDelimited produces, and what --multi wraps
+// multiple top-level documents into), as one CSV/TSV record per row.
+func writeDelimited(w io.Writer, docs []interface{}, delimiter rune) error {
+	if len(docs) != 1 {
+		return fmt.Errorf("csv/tsv encoding supports exactly one document, got %d", len(docs))
+	}
+	rows, ok := docs[0].([]interface{})
+	if !ok {
+		return fmt.Errorf("csv/tsv encoding requires an array document, got %T", docs[0])
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	first, ok := rows[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("csv/tsv encoding requires an array of map rows, got %T", rows[0])
+	}
+	header := make([]string, 0, len(first))
+	for k := range first {
+		header = append(header, k)
+	}
+	sort.Strings(header)
+
+	cw := csv.NewWriter(w)
+	cw.Comma = delimiter
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, d := range rows {
+		m, ok := d.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("csv/tsv encoding requires an array of map rows, got %T", d)
+		}
+		row := make([]string, len(header))
+		for i, h := range header {
+			row[i] = fmt.Sprintf("%v", m[h])
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
 }
 
-func writeYAML(w io.Writer, v interface{}) error {
-	return yaml.NewEncoder(w).Encode(v)
+// readProperties parses a Java-style .properties file, expanding dotted keys
+// into nested maps using propertiesSeparator (e.g. "a.b.c=1" becomes
+// {"a":{"b":{"c":"1"}}}).
+func readProperties(r io.Reader) ([]interface{}, error) {
+	result := map[string]interface{}{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			key, value, found = strings.Cut(line, ":")
+		}
+		if !found {
+			return nil, fmt.Errorf("invalid properties line %q: missing '=' or ':'", line)
+		}
+		path := strings.Split(strings.TrimSpace(key), propertiesSeparator)
+		if err := setPath(result, path, strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("expanding key %q: %s", key, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return []interface{}{result}, nil
 }
 
-func readJSON(v interface{}, r io.Reader) error {
-	return json.NewDecoder(r).Decode(&v)
+// writeProperties flattens a single document's nested maps back into dotted
+// keys, the inverse of readProperties.
+func writeProperties(w io.Writer, docs []interface{}) error {
+	if len(docs) != 1 {
+		return fmt.Errorf("properties encoding supports exactly one document, got %d", len(docs))
+	}
+	m, ok := docs[0].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("properties encoding requires a map[string]interface{} document")
+	}
+	flat := map[string]string{}
+	flattenProperties("", m, flat)
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k, flat[k]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func writeJSON(w io.Writer, v interface{}) error {
-	return json.NewEncoder(w).Encode(&v)
+func flattenProperties(prefix string, m map[string]interface{}, out map[string]string) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + propertiesSeparator + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok {
+			flattenProperties(key, nested, out)
+			continue
+		}
+		out[key] = fmt.Sprintf("%v", v)
+	}
 }
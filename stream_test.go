@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadYAMLMultiDocument(t *testing.T) {
+	input := "a: 1\n---\nb: 2\n"
+	docs, err := readYAML(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readYAML: %s", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents in the stream, got %d", len(docs))
+	}
+	first, ok := docs[0].(map[string]interface{})
+	if !ok || first["a"] != 1 {
+		t.Fatalf("first document: got %#v", docs[0])
+	}
+	second, ok := docs[1].(map[string]interface{})
+	if !ok || second["b"] != 2 {
+		t.Fatalf("second document: got %#v", docs[1])
+	}
+}
+
+func TestYAMLStreamRoundTrip(t *testing.T) {
+	docs := []interface{}{
+		map[string]interface{}{"a": 1},
+		map[string]interface{}{"b": 2},
+	}
+
+	var encoded bytes.Buffer
+	if err := writeYAML(&encoded, docs); err != nil {
+		t.Fatalf("writeYAML: %s", err)
+	}
+
+	roundTripped, err := readYAML(strings.NewReader(encoded.String()))
+	if err != nil {
+		t.Fatalf("readYAML (round trip): %s", err)
+	}
+	if len(roundTripped) != 2 {
+		t.Fatalf("round trip lost documents, got %#v", roundTripped)
+	}
+}
+
+func TestReadJSONConcatenatedDocuments(t *testing.T) {
+	docs, err := readJSON(strings.NewReader(`{"a":1}{"b":2}`))
+	if err != nil {
+		t.Fatalf("readJSON: %s", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 concatenated documents, got %d", len(docs))
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeepMergeReplaceStrategy(t *testing.T) {
+	dst := map[string]interface{}{
+		"a": []interface{}{"x", "y"},
+		"b": map[string]interface{}{"c": 1, "d": 2},
+	}
+	src := map[string]interface{}{
+		"a": []interface{}{"z"},
+		"b": map[string]interface{}{"d": 3},
+	}
+	deepMerge(dst, src, "replace")
+
+	if got := dst["a"].([]interface{}); !reflect.DeepEqual(got, []interface{}{"z"}) {
+		t.Fatalf("slice replace strategy: got %#v", got)
+	}
+	nested := dst["b"].(map[string]interface{})
+	if nested["c"] != 1 || nested["d"] != 3 {
+		t.Fatalf("nested map merge: got %#v", nested)
+	}
+}
+
+func TestMergeSlicesAppend(t *testing.T) {
+	got := mergeSlices([]interface{}{"x", "y"}, []interface{}{"z"}, "append")
+	want := []interface{}{"x", "y", "z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestMergeSlicesDeep(t *testing.T) {
+	dst := []interface{}{map[string]interface{}{"a": 1, "b": 1}}
+	src := []interface{}{map[string]interface{}{"b": 2}, "extra"}
+	got := mergeSlices(dst, src, "deep")
+	want := []interface{}{map[string]interface{}{"a": 1, "b": 2}, "extra"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestPopAndSetPath(t *testing.T) {
+	data := map[string]interface{}{
+		"a": map[string]interface{}{"b": "value"},
+	}
+
+	v, ok := popPath(data, []string{"a", "b"})
+	if !ok || v != "value" {
+		t.Fatalf("popPath: got %#v, %v", v, ok)
+	}
+	if _, ok := data["a"].(map[string]interface{})["b"]; ok {
+		t.Fatalf("popPath did not remove the key")
+	}
+
+	if err := setPath(data, []string{"x", "y"}, "value"); err != nil {
+		t.Fatalf("setPath: %s", err)
+	}
+	if got := data["x"].(map[string]interface{})["y"]; got != "value" {
+		t.Fatalf("setPath did not create the nested path: %#v", data)
+	}
+}
+
+func TestApplyRenamesMovesAndNests(t *testing.T) {
+	data := map[string]interface{}{"old": "value", "keep": "untouched"}
+	if err := applyRenames(data, []string{"old=new.nested"}); err != nil {
+		t.Fatalf("applyRenames: %s", err)
+	}
+	if _, ok := data["old"]; ok {
+		t.Fatalf("old key still present: %#v", data)
+	}
+	nested, ok := data["new"].(map[string]interface{})
+	if !ok || nested["nested"] != "value" {
+		t.Fatalf("rename did not land at new.nested: %#v", data)
+	}
+	if data["keep"] != "untouched" {
+		t.Fatalf("unrelated key was touched: %#v", data)
+	}
+}
+
+func TestApplyRenamesMissingPathIsNoop(t *testing.T) {
+	data := map[string]interface{}{"keep": "untouched"}
+	if err := applyRenames(data, []string{"missing=elsewhere"}); err != nil {
+		t.Fatalf("applyRenames: %s", err)
+	}
+	if len(data) != 1 || data["keep"] != "untouched" {
+		t.Fatalf("missing rename source mutated data: %#v", data)
+	}
+}
+
+func TestTransformDocFilter(t *testing.T) {
+	doc := map[string]interface{}{"name": "alice", "age": 30.0}
+	result, err := transformDoc(doc, convertOptions{filterExpr: ".name"})
+	if err != nil {
+		t.Fatalf("transformDoc: %s", err)
+	}
+	if result != "alice" {
+		t.Fatalf("got %#v, want %q", result, "alice")
+	}
+}
+
+func TestTransformDocRenameRequiresMapDocument(t *testing.T) {
+	opts := convertOptions{renames: []string{"a=b"}}
+	if _, err := transformDoc([]interface{}{"not", "a", "map"}, opts); err == nil {
+		t.Fatalf("expected an error for a non-map document with --rename")
+	}
+}